@@ -0,0 +1,499 @@
+// backend.go
+// Pluggable storage backend behind a single Backend interface, selected from
+// a URI scheme: redis:// and rediss:// (standalone, optionally TLS),
+// redis-sentinel:// (failover via Sentinel), redis-cluster:// (Redis
+// Cluster), and memory:// (an in-process fake for tests and single-node
+// deployments that don't want a Redis dependency at all). RedisManager wraps
+// whichever Backend NewBackend returns and is the one connection shared by
+// SessionStore, the events consumer, and the metrics writer.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrNotFound is returned by Backend.Get for a missing key, in place of the
+// Redis-specific redis.Nil so callers don't need to know which backend is
+// live.
+var ErrNotFound = errors.New("backend: key not found")
+
+// StreamEntry is one entry read back from XAdd/XRead/XRange, backend-agnostic.
+type StreamEntry struct {
+	ID      string
+	Payload string
+}
+
+// Backend is the storage surface the app needs: a string key/value store
+// with TTLs, sets for the active-session index, and an append-only stream
+// for events. Every RedisManager method is a thin passthrough to one of
+// these.
+type Backend interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key, value string, expire time.Duration) error
+	SAdd(ctx context.Context, key, member string) error
+	SRem(ctx context.Context, key, member string) error
+	SMembers(ctx context.Context, key string) ([]string, error)
+	SCard(ctx context.Context, key string) (int64, error)
+	XAdd(ctx context.Context, stream string, maxLen int64, values map[string]any) (string, error)
+	XRead(ctx context.Context, stream, lastID string, block time.Duration, count int64) ([]StreamEntry, error)
+	XRange(ctx context.Context, stream, start, stop string) ([]StreamEntry, error)
+	Ping(ctx context.Context) error
+	// Health returns a small set of operator-facing health fields (e.g.
+	// connected_clients, used_memory for Redis); backends that have nothing
+	// comparable return an empty map rather than an error.
+	Health(ctx context.Context) (map[string]string, error)
+	Close() error
+}
+
+// NewBackend dispatches on uri's scheme to build the right Backend:
+//
+//	redis://[user:pass@]host:port[/db][?pool_size=&dial_timeout=&read_timeout=]
+//	rediss://...                                    (TLS; ?insecure=1 to skip verification)
+//	redis-sentinel://[user:pass@]master/host1,host2[?db=]
+//	redis-cluster://host1,host2[?pool_size=...]
+//	memory://                                       (in-process fake, ignores the rest of the URI)
+func NewBackend(ctx context.Context, uri string) (Backend, error) {
+	if uri == "" {
+		uri = "redis://localhost:6379"
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("parse backend uri: %w", err)
+	}
+
+	switch u.Scheme {
+	case "memory":
+		return newMemoryBackend(), nil
+	case "redis", "rediss":
+		return newRedisBackend(ctx, u, false)
+	case "redis-sentinel":
+		return newRedisBackend(ctx, u, false)
+	case "redis-cluster":
+		return newRedisBackend(ctx, u, true)
+	default:
+		return nil, fmt.Errorf("unsupported backend scheme %q", u.Scheme)
+	}
+}
+
+// ====== Redis-backed implementation (standalone, TLS, sentinel, cluster) ======
+
+// redisBackend wraps a redis.UniversalClient, which go-redis itself resolves
+// to a standalone, Sentinel-failover, or Cluster client depending on the
+// UniversalOptions it's given — this is what lets one Backend type cover
+// redis://, redis-sentinel://, and redis-cluster:// without duplicating the
+// command plumbing three times.
+type redisBackend struct {
+	uc redis.UniversalClient
+}
+
+func newRedisBackend(ctx context.Context, u *url.URL, cluster bool) (*redisBackend, error) {
+	q := u.Query()
+
+	username := ""
+	password := ""
+	if u.User != nil {
+		username = u.User.Username()
+		password, _ = u.User.Password()
+	}
+
+	db := 0
+	if u.Scheme != "redis-cluster" {
+		if path := strings.TrimPrefix(u.Path, "/"); path != "" {
+			if n, err := strconv.Atoi(path); err == nil {
+				db = n
+			}
+		}
+		if v := q.Get("db"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil {
+				db = n
+			}
+		}
+	}
+
+	opts := &redis.UniversalOptions{
+		Username: username,
+		Password: password,
+		DB:       db,
+	}
+	if v := q.Get("pool_size"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			opts.PoolSize = n
+		}
+	}
+	if v := q.Get("dial_timeout"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			opts.DialTimeout = d
+		}
+	}
+	if v := q.Get("read_timeout"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			opts.ReadTimeout = d
+		}
+	}
+
+	switch {
+	case u.Scheme == "redis-sentinel":
+		// redis-sentinel://master@host1,host2/?db=0 — the "user" portion of a
+		// sentinel URI names the master, not a Redis ACL user.
+		if u.User != nil {
+			opts.MasterName = u.User.Username()
+		}
+		opts.Username = ""
+		opts.Addrs = strings.Split(u.Host, ",")
+	case cluster:
+		opts.Addrs = strings.Split(u.Host, ",")
+	default:
+		addr := u.Host
+		if addr == "" {
+			addr = "localhost:6379"
+		}
+		opts.Addrs = []string{addr}
+	}
+
+	if u.Scheme == "rediss" {
+		opts.TLSConfig = &tls.Config{InsecureSkipVerify: q.Get("insecure") == "1"}
+	}
+
+	uc := redis.NewUniversalClient(opts)
+	if err := uc.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("ping backend: %w", err)
+	}
+	return &redisBackend{uc: uc}, nil
+}
+
+func (b *redisBackend) Get(ctx context.Context, key string) (string, error) {
+	v, err := b.uc.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrNotFound
+	}
+	return v, err
+}
+
+func (b *redisBackend) Set(ctx context.Context, key, value string, expire time.Duration) error {
+	return b.uc.Set(ctx, key, value, expire).Err()
+}
+
+func (b *redisBackend) SAdd(ctx context.Context, key, member string) error {
+	return b.uc.SAdd(ctx, key, member).Err()
+}
+
+func (b *redisBackend) SRem(ctx context.Context, key, member string) error {
+	return b.uc.SRem(ctx, key, member).Err()
+}
+
+func (b *redisBackend) SMembers(ctx context.Context, key string) ([]string, error) {
+	return b.uc.SMembers(ctx, key).Result()
+}
+
+func (b *redisBackend) SCard(ctx context.Context, key string) (int64, error) {
+	return b.uc.SCard(ctx, key).Result()
+}
+
+func (b *redisBackend) XAdd(ctx context.Context, stream string, maxLen int64, values map[string]any) (string, error) {
+	return b.uc.XAdd(ctx, &redis.XAddArgs{Stream: stream, MaxLen: maxLen, Approx: true, Values: values}).Result()
+}
+
+func (b *redisBackend) XRead(ctx context.Context, stream, lastID string, block time.Duration, count int64) ([]StreamEntry, error) {
+	res, err := b.uc.XRead(ctx, &redis.XReadArgs{Streams: []string{stream, lastID}, Block: block, Count: count}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []StreamEntry
+	for _, s := range res {
+		for _, msg := range s.Messages {
+			payload, _ := msg.Values["payload"].(string)
+			out = append(out, StreamEntry{ID: msg.ID, Payload: payload})
+		}
+	}
+	return out, nil
+}
+
+func (b *redisBackend) XRange(ctx context.Context, stream, start, stop string) ([]StreamEntry, error) {
+	res, err := b.uc.XRange(ctx, stream, start, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]StreamEntry, 0, len(res))
+	for _, msg := range res {
+		payload, _ := msg.Values["payload"].(string)
+		out = append(out, StreamEntry{ID: msg.ID, Payload: payload})
+	}
+	return out, nil
+}
+
+func (b *redisBackend) Ping(ctx context.Context) error { return b.uc.Ping(ctx).Err() }
+func (b *redisBackend) Close() error                   { return b.uc.Close() }
+
+// redisHealthFields is the subset of `INFO`'s key: value lines operators
+// actually want on a metrics dashboard; everything else is dropped.
+var redisHealthFields = map[string]bool{
+	"connected_clients": true,
+	"used_memory":       true,
+	"role":              true,
+}
+
+func (b *redisBackend) Health(ctx context.Context) (map[string]string, error) {
+	info, err := b.uc.Info(ctx, "clients", "memory", "replication").Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis info: %w", err)
+	}
+	out := map[string]string{}
+	for _, line := range strings.Split(info, "\r\n") {
+		k, v, ok := strings.Cut(line, ":")
+		if !ok || !redisHealthFields[k] {
+			continue
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+// ====== In-memory fake (tests, single-node deployments without Redis) ======
+
+type memoryStream struct {
+	entries []StreamEntry
+	nextSeq int
+}
+
+// memoryBackend is a single-process stand-in for Backend. It's deliberately
+// simple — no persistence, no real blocking I/O — since its only jobs are
+// letting tests run without a Redis instance and letting `memory://` serve a
+// single-replica deployment.
+type memoryBackend struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	strings map[string]string
+	sets    map[string]map[string]struct{}
+	streams map[string]*memoryStream
+}
+
+func newMemoryBackend() *memoryBackend {
+	b := &memoryBackend{
+		strings: map[string]string{},
+		sets:    map[string]map[string]struct{}{},
+		streams: map[string]*memoryStream{},
+	}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+func (b *memoryBackend) Get(ctx context.Context, key string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	v, ok := b.strings[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+func (b *memoryBackend) Set(ctx context.Context, key, value string, expire time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.strings[key] = value
+	if expire > 0 {
+		go func() {
+			time.Sleep(expire)
+			b.mu.Lock()
+			if b.strings[key] == value {
+				delete(b.strings, key)
+			}
+			b.mu.Unlock()
+		}()
+	}
+	return nil
+}
+
+func (b *memoryBackend) SAdd(ctx context.Context, key, member string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	set, ok := b.sets[key]
+	if !ok {
+		set = map[string]struct{}{}
+		b.sets[key] = set
+	}
+	set[member] = struct{}{}
+	return nil
+}
+
+func (b *memoryBackend) SRem(ctx context.Context, key, member string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.sets[key], member)
+	return nil
+}
+
+func (b *memoryBackend) SMembers(ctx context.Context, key string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]string, 0, len(b.sets[key]))
+	for m := range b.sets[key] {
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func (b *memoryBackend) SCard(ctx context.Context, key string) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int64(len(b.sets[key])), nil
+}
+
+func (b *memoryBackend) XAdd(ctx context.Context, stream string, maxLen int64, values map[string]any) (string, error) {
+	payload, _ := values["payload"].(string)
+	b.mu.Lock()
+	s, ok := b.streams[stream]
+	if !ok {
+		s = &memoryStream{}
+		b.streams[stream] = s
+	}
+	s.nextSeq++
+	id := fmt.Sprintf("%d-%d", time.Now().UnixMilli(), s.nextSeq)
+	s.entries = append(s.entries, StreamEntry{ID: id, Payload: payload})
+	if maxLen > 0 && int64(len(s.entries)) > maxLen {
+		s.entries = s.entries[int64(len(s.entries))-maxLen:]
+	}
+	b.mu.Unlock()
+	b.cond.Broadcast()
+	return id, nil
+}
+
+func (b *memoryBackend) XRead(ctx context.Context, stream, lastID string, block time.Duration, count int64) ([]StreamEntry, error) {
+	deadline := time.Now().Add(block)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// "$" means "only entries added after this call", same as real Redis.
+	// Resolve it once, up front, to the stream's current tail ID (or the
+	// zero ID if the stream doesn't exist yet) so the retry loop below
+	// tracks a fixed point in time instead of re-resolving "$" to "now"
+	// on every iteration, which would make it impossible to ever observe
+	// an entry added while blocked.
+	cursor := lastID
+	if cursor == "$" {
+		cursor = "0-0"
+		if s, ok := b.streams[stream]; ok && len(s.entries) > 0 {
+			cursor = s.entries[len(s.entries)-1].ID
+		}
+	}
+
+	for {
+		if s, ok := b.streams[stream]; ok {
+			out := entriesAfter(s.entries, cursor)
+			if len(out) > 0 {
+				if count > 0 && int64(len(out)) > count {
+					out = out[:count]
+				}
+				return out, nil
+			}
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, nil
+		}
+		timer := time.AfterFunc(remaining, b.cond.Broadcast)
+		b.cond.Wait()
+		timer.Stop()
+		if time.Now().After(deadline) {
+			return nil, nil
+		}
+	}
+}
+
+func (b *memoryBackend) XRange(ctx context.Context, stream, start, stop string) ([]StreamEntry, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.streams[stream]
+	if !ok {
+		return nil, nil
+	}
+	out := entriesAfter(s.entries, start)
+	if stop != "+" {
+		trimmed := out[:0]
+		for _, e := range out {
+			if compareStreamIDs(e.ID, stop) > 0 {
+				break
+			}
+			trimmed = append(trimmed, e)
+		}
+		out = trimmed
+	}
+	return out, nil
+}
+
+// compareStreamIDs orders two "<unixmilli>-<seq>" IDs numerically rather
+// than lexically: seq never resets and its digit width grows unboundedly
+// over a stream's lifetime, so a plain string compare silently goes wrong
+// the moment seq crosses a power-of-ten boundary (e.g. "...-10" < "...-9"
+// as strings). Returns -1, 0, or 1 the way strings.Compare does. A
+// malformed half (neither "-" nor "$" nor "+" should ever reach here) parses
+// as 0, which is the same conservative direction XRead/XRange already fall
+// back to elsewhere in this file.
+func compareStreamIDs(a, b string) int {
+	aMs, aSeq := parseStreamID(a)
+	bMs, bSeq := parseStreamID(b)
+	if aMs != bMs {
+		if aMs < bMs { return -1 }
+		return 1
+	}
+	if aSeq != bSeq {
+		if aSeq < bSeq { return -1 }
+		return 1
+	}
+	return 0
+}
+
+func parseStreamID(id string) (ms, seq int64) {
+	msPart, seqPart, ok := strings.Cut(id, "-")
+	if !ok {
+		n, _ := strconv.ParseInt(id, 10, 64)
+		return n, 0
+	}
+	ms, _ = strconv.ParseInt(msPart, 10, 64)
+	seq, _ = strconv.ParseInt(seqPart, 10, 64)
+	return ms, seq
+}
+
+// entriesAfter returns every entry with an ID greater than cursor ("-" means
+// "from the very start"; "+" never appears here as a cursor). XRead resolves
+// "$" to a concrete tail ID before calling this, so "$"/"" reaching here
+// still falls back to the conservative "nothing yet" reading rather than
+// "from the very start".
+func entriesAfter(entries []StreamEntry, cursor string) []StreamEntry {
+	if cursor == "-" {
+		return entries
+	}
+	if cursor == "$" || cursor == "" {
+		return nil
+	}
+	out := make([]StreamEntry, 0, len(entries))
+	for _, e := range entries {
+		if compareStreamIDs(e.ID, cursor) > 0 {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func (b *memoryBackend) Ping(ctx context.Context) error { return nil }
+func (b *memoryBackend) Close() error                   { return nil }
+
+// Health has nothing to report: memoryBackend has no server process to
+// introspect.
+func (b *memoryBackend) Health(ctx context.Context) (map[string]string, error) {
+	return map[string]string{}, nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryBackendStringsAndSets(t *testing.T) {
+	ctx := context.Background()
+	b := newMemoryBackend()
+
+	if _, err := b.Get(ctx, "missing"); err != ErrNotFound {
+		t.Fatalf("Get(missing) error = %v, want ErrNotFound", err)
+	}
+	if err := b.Set(ctx, "k", "v", 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if v, err := b.Get(ctx, "k"); err != nil || v != "v" {
+		t.Fatalf("Get(k) = %q, %v, want \"v\", nil", v, err)
+	}
+
+	if err := b.SAdd(ctx, "s", "a"); err != nil {
+		t.Fatalf("SAdd: %v", err)
+	}
+	if err := b.SAdd(ctx, "s", "b"); err != nil {
+		t.Fatalf("SAdd: %v", err)
+	}
+	if n, err := b.SCard(ctx, "s"); err != nil || n != 2 {
+		t.Fatalf("SCard = %d, %v, want 2, nil", n, err)
+	}
+	if err := b.SRem(ctx, "s", "a"); err != nil {
+		t.Fatalf("SRem: %v", err)
+	}
+	members, err := b.SMembers(ctx, "s")
+	if err != nil || len(members) != 1 || members[0] != "b" {
+		t.Fatalf("SMembers = %v, %v, want [b], nil", members, err)
+	}
+}
+
+func TestMemoryBackendXReadDollarSeesEntriesAddedAfterTheCall(t *testing.T) {
+	ctx := context.Background()
+	b := newMemoryBackend()
+
+	// A consumer that starts at "$" is asking for only entries added after
+	// this call, same as real Redis: it must not re-resolve "$" to "nothing
+	// yet" on every retry, or a concurrently XAdd-ed entry is never seen.
+	done := make(chan []StreamEntry, 1)
+	go func() {
+		entries, err := b.XRead(ctx, "stream", "$", 2*time.Second, 100)
+		if err != nil {
+			t.Errorf("XRead: %v", err)
+		}
+		done <- entries
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if _, err := b.XAdd(ctx, "stream", 0, map[string]any{"payload": "hello"}); err != nil {
+		t.Fatalf("XAdd: %v", err)
+	}
+
+	select {
+	case entries := <-done:
+		if len(entries) != 1 || entries[0].Payload != "hello" {
+			t.Fatalf("XRead($) returned %v, want one entry with payload \"hello\"", entries)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("XRead($) never returned the concurrently added entry")
+	}
+}
+
+func TestMemoryBackendXReadDollarIgnoresEntriesAddedBeforeTheCall(t *testing.T) {
+	ctx := context.Background()
+	b := newMemoryBackend()
+
+	if _, err := b.XAdd(ctx, "stream", 0, map[string]any{"payload": "before"}); err != nil {
+		t.Fatalf("XAdd: %v", err)
+	}
+
+	entries, err := b.XRead(ctx, "stream", "$", 100*time.Millisecond, 100)
+	if err != nil {
+		t.Fatalf("XRead: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("XRead($) = %v, want no entries already in the stream before the call", entries)
+	}
+}
+
+// TestMemoryBackendXReadSurvivesSeqDigitWidthGrowth reproduces a cursor
+// comparison bug: stream IDs are "<unixmilli>-<seq>" and seq never resets,
+// so once two entries land in the same millisecond and seq crosses a
+// power-of-ten boundary (e.g. "...-9" then "...-10"), a plain lexical ID
+// compare says "...-10" < "...-9" and a consumer parked at "...-9" never
+// sees anything added after it.
+func TestMemoryBackendXReadSurvivesSeqDigitWidthGrowth(t *testing.T) {
+	ctx := context.Background()
+	b := newMemoryBackend()
+
+	var ids []string
+	for i := 0; i < 11; i++ {
+		id, err := b.XAdd(ctx, "stream", 0, map[string]any{"payload": "e"})
+		if err != nil {
+			t.Fatalf("XAdd: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	// Park the cursor at the 9th entry (ID ending "-9"); the 10th and 11th
+	// end "-10" and "-11", which lexically compare less than "-9".
+	cursor := ids[8]
+	entries, err := b.XRead(ctx, "stream", cursor, 100*time.Millisecond, 100)
+	if err != nil {
+		t.Fatalf("XRead: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("XRead(%q) returned %d entries, want 2 (the two added after it)", cursor, len(entries))
+	}
+}
+
+func TestMemoryBackendXRange(t *testing.T) {
+	ctx := context.Background()
+	b := newMemoryBackend()
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err := b.XAdd(ctx, "stream", 0, map[string]any{"payload": string(rune('a' + i))})
+		if err != nil {
+			t.Fatalf("XAdd: %v", err)
+		}
+		ids = append(ids, id)
+		time.Sleep(time.Millisecond)
+	}
+
+	out, err := b.XRange(ctx, "stream", "-", "+")
+	if err != nil {
+		t.Fatalf("XRange: %v", err)
+	}
+	if len(out) != 3 {
+		t.Fatalf("XRange(-, +) returned %d entries, want 3", len(out))
+	}
+
+	out, err = b.XRange(ctx, "stream", ids[0], "+")
+	if err != nil {
+		t.Fatalf("XRange: %v", err)
+	}
+	if len(out) != 2 {
+		t.Fatalf("XRange(%s, +) returned %d entries, want 2 (after the first)", ids[0], len(out))
+	}
+}
+
+func TestNewBackendDispatchesOnScheme(t *testing.T) {
+	ctx := context.Background()
+
+	b, err := NewBackend(ctx, "memory://")
+	if err != nil {
+		t.Fatalf("NewBackend(memory://): %v", err)
+	}
+	if _, ok := b.(*memoryBackend); !ok {
+		t.Fatalf("NewBackend(memory://) = %T, want *memoryBackend", b)
+	}
+
+	if _, err := NewBackend(ctx, "ftp://localhost"); err == nil {
+		t.Fatal("NewBackend(ftp://...) err = nil, want unsupported scheme error")
+	}
+}
@@ -0,0 +1,274 @@
+// engine.go
+// Pluggable automation engines. An AutomationEngine drives one session to
+// completion, reporting incremental progress over a channel; the caller
+// (main.go) is responsible for persisting that progress and streaming it to
+// WebSocket clients via publishEvent.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// ProgressEvent is one incremental update from an AutomationEngine.
+type ProgressEvent struct {
+	Progress int
+	Metrics  map[string]any
+	Err      error
+}
+
+// AutomationEngine drives a single session's browsing behavior. Run blocks
+// until the session finishes, fails, or ctx is cancelled (e.g. via Cancel);
+// it must close progress before returning.
+type AutomationEngine interface {
+	Run(ctx context.Context, sess *Session, progress chan<- ProgressEvent) error
+	Cancel(sessionID string)
+}
+
+// engines holds every registered AutomationEngine by name.
+var engines = map[string]AutomationEngine{
+	"simulator": &SimulatorEngine{cancels: map[string]context.CancelFunc{}},
+	"chromedp":  &ChromedpEngine{cancels: map[string]context.CancelFunc{}},
+	"rod":       &RodEngine{},
+}
+
+// engineFor resolves the engine for a request: the explicit name if it's
+// registered, falling back to the ENGINE env var, falling back to "simulator".
+func engineFor(name string) (string, AutomationEngine, error) {
+	if name == "" {
+		name = os.Getenv("ENGINE")
+	}
+	if name == "" {
+		name = "simulator"
+	}
+	e, ok := engines[name]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown engine %q", name)
+	}
+	return name, e, nil
+}
+
+// ====== Simulator engine (demo behavior, no real browser) ======
+
+// SimulatorEngine reproduces the original demo behavior: it advances
+// progress on a timer without touching a real browser. Useful for local
+// development and tests that don't want a chromedp dependency.
+type SimulatorEngine struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+func (e *SimulatorEngine) Run(ctx context.Context, sess *Session, progress chan<- ProgressEvent) error {
+	defer close(progress)
+
+	ctx, cancel := context.WithCancel(ctx)
+	e.mu.Lock()
+	e.cancels[sess.SessionID] = cancel
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		delete(e.cancels, sess.SessionID)
+		e.mu.Unlock()
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	step := 0
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(1 * time.Second):
+		}
+		step++
+		progress <- ProgressEvent{
+			Progress: min(100, step*10),
+			Metrics:  map[string]any{"last_step_ms": 800 + step*25},
+		}
+	}
+	progress <- ProgressEvent{Progress: 100}
+	return nil
+}
+
+func (e *SimulatorEngine) Cancel(sessionID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if cancel, ok := e.cancels[sessionID]; ok {
+		cancel()
+	}
+}
+
+// ====== Chromedp engine (real browser automation) ======
+
+// behaviorStep is one action in a BehaviorPattern's scroll/click/dwell script.
+type behaviorStep struct {
+	scrollBy int           // pixels to scroll down, 0 to skip
+	click    string         // CSS selector to click, "" to skip
+	dwell    time.Duration // time to wait after the action
+}
+
+// behaviorScript maps a BehaviorPattern to the scroll/click/dwell distribution
+// that a visitor of that type would plausibly produce.
+func behaviorScript(p BehaviorPattern) []behaviorStep {
+	switch p {
+	case BehaviorCasual:
+		return []behaviorStep{
+			{scrollBy: 300, dwell: 2 * time.Second},
+			{scrollBy: 600, dwell: 3 * time.Second},
+			{scrollBy: 200, dwell: 1 * time.Second},
+		}
+	case BehaviorFocused:
+		return []behaviorStep{
+			{click: "a, button", dwell: 500 * time.Millisecond},
+			{scrollBy: 800, dwell: 500 * time.Millisecond},
+			{click: "a, button", dwell: 500 * time.Millisecond},
+		}
+	case BehaviorExplorer:
+		return []behaviorStep{
+			{scrollBy: 1200, dwell: 1 * time.Second},
+			{click: "a", dwell: 1 * time.Second},
+			{scrollBy: 1200, dwell: 1 * time.Second},
+			{click: "a", dwell: 1 * time.Second},
+		}
+	case BehaviorScanner:
+		return []behaviorStep{
+			{scrollBy: 2000, dwell: 300 * time.Millisecond},
+			{scrollBy: 2000, dwell: 300 * time.Millisecond},
+			{scrollBy: 2000, dwell: 300 * time.Millisecond},
+		}
+	case BehaviorResearch:
+		return []behaviorStep{
+			{scrollBy: 500, dwell: 4 * time.Second},
+			{click: "a", dwell: 3 * time.Second},
+			{scrollBy: 500, dwell: 4 * time.Second},
+		}
+	default:
+		return []behaviorStep{{scrollBy: 400, dwell: 1 * time.Second}}
+	}
+}
+
+// ChromedpEngine drives a real, headless-or-not Chrome instance via chromedp.
+type ChromedpEngine struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+func (e *ChromedpEngine) Run(ctx context.Context, sess *Session, progress chan<- ProgressEvent) error {
+	defer close(progress)
+
+	timeout := time.Duration(sess.TimeoutSec) * time.Second
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	e.mu.Lock()
+	e.cancels[sess.SessionID] = cancel
+	e.mu.Unlock()
+	defer func() {
+		cancel()
+		e.mu.Lock()
+		delete(e.cancels, sess.SessionID)
+		e.mu.Unlock()
+	}()
+
+	opts := append([]chromedp.ExecAllocatorOption{}, chromedp.DefaultExecAllocatorOptions[:]...)
+	opts = append(opts, chromedp.Flag("headless", sess.Headless))
+	// Proxy is attached via the engine field on Session, not AutomationRequest,
+	// so it survives the roundtrip through Redis for cancellation/inspection.
+	if sess.Proxy != nil && *sess.Proxy != "" {
+		opts = append(opts, chromedp.ProxyServer(*sess.Proxy))
+	}
+
+	allocCtx, allocCancel := chromedp.NewExecAllocator(ctx, opts...)
+	defer allocCancel()
+	browserCtx, browserCancel := chromedp.NewContext(allocCtx)
+	defer browserCancel()
+
+	start := time.Now()
+	if err := chromedp.Run(browserCtx, chromedp.Navigate(sess.URL)); err != nil {
+		return fmt.Errorf("navigate: %w", err)
+	}
+	loadMs := time.Since(start).Milliseconds()
+
+	var nodeCount int
+	_ = chromedp.Run(browserCtx, chromedp.Evaluate(`document.getElementsByTagName('*').length`, &nodeCount))
+
+	if sess.CustomScript != nil && *sess.CustomScript != "" {
+		var result any
+		if err := chromedp.Run(browserCtx, chromedp.Evaluate(*sess.CustomScript, &result)); err != nil {
+			return fmt.Errorf("custom_script: %w", err)
+		}
+	}
+
+	steps := behaviorScript(sess.BehaviorPattern)
+	total := sess.MaxInteractions
+	if total <= 0 {
+		total = len(steps)
+	} else if total > len(steps)*4 {
+		total = len(steps) * 4
+	}
+
+	for i := 0; i < total; i++ {
+		step := steps[i%len(steps)]
+		stepStart := time.Now()
+
+		var actions []chromedp.Action
+		if step.scrollBy > 0 {
+			actions = append(actions, chromedp.Evaluate(fmt.Sprintf("window.scrollBy(0, %d)", step.scrollBy), nil))
+		}
+		if step.click != "" {
+			actions = append(actions, chromedp.Click(step.click, chromedp.ByQuery))
+		}
+		if len(actions) > 0 {
+			if err := chromedp.Run(browserCtx, actions...); err != nil {
+				// A missing selector/element is expected behavior variance, not a
+				// fatal error for the session — keep going with the next step.
+				continue
+			}
+		}
+		if step.dwell > 0 {
+			select {
+			case <-browserCtx.Done():
+				return browserCtx.Err()
+			case <-time.After(step.dwell):
+			}
+		}
+
+		progress <- ProgressEvent{
+			Progress: min(100, ((i+1)*100)/total),
+			Metrics: map[string]any{
+				"page_load_ms":    loadMs,
+				"dom_node_count":  nodeCount,
+				"network_requests": i + 1, // one navigation/interaction round-trip per step
+				"last_step_ms":    time.Since(stepStart).Milliseconds(),
+			},
+		}
+	}
+
+	return nil
+}
+
+func (e *ChromedpEngine) Cancel(sessionID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if cancel, ok := e.cancels[sessionID]; ok {
+		cancel()
+	}
+}
+
+// ====== Rod engine (not yet implemented) ======
+
+// RodEngine is a registered placeholder for a github.com/go-rod/rod-backed
+// driver. It's wired into the registry so `engine: "rod"` round-trips
+// through validation instead of 404ing, but Run intentionally fails until a
+// real implementation lands.
+type RodEngine struct{}
+
+func (e *RodEngine) Run(ctx context.Context, sess *Session, progress chan<- ProgressEvent) error {
+	close(progress)
+	return fmt.Errorf("rod engine not implemented")
+}
+
+func (e *RodEngine) Cancel(sessionID string) {}
@@ -0,0 +1,310 @@
+// hub.go
+// Topic-filtered WebSocket fan-out with per-connection backpressure and
+// resumability. A single shared consumer (see main.go) reads the events
+// stream with one blocking XREAD and hands each entry to Hub.Broadcast,
+// which fans it out to every client subscribed to its topic — one
+// connected client's slow socket only costs that client's outbox, and the
+// backend only ever sees one long-lived reader regardless of how many
+// WebSocket clients are connected. A reconnecting client additionally
+// passes ?since=<id> on the /ws upgrade; on its first subscribe message
+// (the earliest point its topics are known) WSClient.catchUp replays
+// anything it missed via the same XRANGE GET /api/sessions/:id/events
+// already uses, rather than opening a second per-client stream reader.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	websock "github.com/gofiber/websocket/v2"
+)
+
+const (
+	sendBufferSize = 256
+	writeWait      = 10 * time.Second
+	defaultPing    = 30 * time.Second
+)
+
+// pingInterval is configurable via WS_PING_INTERVAL_SEC so operators can trade
+// keepalive promptness against connection chatter without a rebuild.
+var pingInterval = func() time.Duration {
+	if v := os.Getenv("WS_PING_INTERVAL_SEC"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return time.Duration(n) * time.Second
+		}
+	}
+	return defaultPing
+}()
+
+// pongWait is how long we tolerate a client going quiet before we consider the
+// connection dead; it must exceed pingInterval so a missed ping or two
+// doesn't immediately kill the connection.
+func pongWait() time.Duration { return pingInterval * 3 }
+
+// subscribeMsg is the client->server control message on /ws.
+type subscribeMsg struct {
+	Action string   `json:"action"` // "subscribe" or "unsubscribe"
+	Topics []string `json:"topics"`
+}
+
+type WSClient struct {
+	conn   *websock.Conn
+	send   chan []byte
+	mu     sync.Mutex // guards topics and lastID
+	topics map[string]struct{}
+	once   sync.Once
+
+	// lastID is this client's resume cursor: "$" means "live tail only" (a
+	// brand-new connection), anything else is the ?since=<id> it connected
+	// with. catchUp advances it once, to the last entry it replayed; live
+	// delivery through Hub.Broadcast keeps it advancing after that.
+	lastID string
+	// caughtUp is set once this connection's one-time catch-up replay has
+	// run (or been skipped for a "$" client); touched only from readPump's
+	// own goroutine, so it needs no lock.
+	caughtUp bool
+}
+
+func newWSClient(c *websock.Conn, since string) *WSClient {
+	if since == "" {
+		since = "$"
+	}
+	return &WSClient{conn: c, send: make(chan []byte, sendBufferSize), topics: map[string]struct{}{}, lastID: since}
+}
+
+func (c *WSClient) subscribe(topics []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range topics {
+		c.topics[t] = struct{}{}
+	}
+}
+
+func (c *WSClient) unsubscribe(topics []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range topics {
+		delete(c.topics, t)
+	}
+}
+
+func (c *WSClient) subscribedAny(topics []string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range topics {
+		if _, ok := c.topics[t]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *WSClient) setLastID(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastID = id
+}
+
+func (c *WSClient) getLastID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastID
+}
+
+// writePump is the sole writer of c.conn: every outgoing frame, whether a
+// broadcast payload or a keepalive ping, goes through here so writes never
+// race. The ping timer is reset on every successful write, same as it would
+// be reset after any activity in a netstack-style deadline guard.
+func (c *WSClient) writePump() {
+	ticker := time.NewTimer(pingInterval)
+	defer func() {
+		ticker.Stop()
+		_ = c.conn.Close()
+	}()
+	for {
+		select {
+		case msg, ok := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				_ = c.conn.WriteMessage(websock.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websock.TextMessage, msg); err != nil {
+				return
+			}
+			if !ticker.Stop() {
+				<-ticker.C
+			}
+			ticker.Reset(pingInterval)
+		case <-ticker.C:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websock.PingMessage, nil); err != nil {
+				return
+			}
+			ticker.Reset(pingInterval)
+		}
+	}
+}
+
+// readPump blocks reading control frames (subscribe/unsubscribe) until the
+// client disconnects or goes quiet past pongWait. The first subscribe
+// triggers this connection's one-time catch-up replay (see catchUp) now
+// that its topics are known.
+func (c *WSClient) readPump(ctx context.Context, rm *RedisManager, h *Hub) {
+	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait()))
+	c.conn.SetPongHandler(func(string) error {
+		_ = c.conn.SetReadDeadline(time.Now().Add(pongWait()))
+		return nil
+	})
+	for {
+		_, raw, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var m subscribeMsg
+		if err := json.Unmarshal(raw, &m); err != nil {
+			continue
+		}
+		switch m.Action {
+		case "subscribe":
+			c.subscribe(m.Topics)
+			if !c.caughtUp {
+				c.caughtUp = true
+				c.catchUp(ctx, rm, h)
+			}
+		case "unsubscribe":
+			c.unsubscribe(m.Topics)
+		}
+	}
+}
+
+// catchUp replays, once, everything published since this connection's
+// ?since=<id> via XRANGE — the same replay mechanism GET
+// /api/sessions/:id/events already uses — rather than giving this client
+// its own blocking stream reader. It runs from the first subscribe message,
+// the earliest point its topics are known, and filters the replay against
+// exactly those topics. Because live delivery through Hub.Broadcast is
+// already active by the time this XRANGE snapshot runs (subscribe happens
+// first), an entry published in that race window may be delivered twice;
+// a reconnecting client tolerating a duplicate is far safer than one
+// silently missing it.
+func (c *WSClient) catchUp(ctx context.Context, rm *RedisManager, h *Hub) {
+	since := c.getLastID()
+	if since == "$" {
+		return
+	}
+	entries, err := rm.XRange(ctx, eventsStream, since, "+")
+	if err != nil {
+		log.Printf("ws client: catch-up xrange failed: %v", err)
+		return
+	}
+	for _, e := range entries {
+		var v map[string]any
+		if err := json.Unmarshal([]byte(e.Payload), &v); err != nil {
+			continue
+		}
+		if !c.subscribedAny(eventTopics(v)) {
+			continue
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		select {
+		case c.send <- b:
+			c.setLastID(e.ID)
+		default:
+			log.Printf("hub: client outbox full during catch-up, dropping connection")
+			websocketBroadcastDroppedTotal.Inc()
+			go h.Remove(c)
+			return
+		}
+	}
+}
+
+// close is safe to call more than once and from more than one goroutine
+// (the hub overflow path and the normal disconnect path can both fire).
+func (c *WSClient) close() {
+	c.once.Do(func() { close(c.send) })
+}
+
+type Hub struct {
+	clients map[*WSClient]struct{}
+	mu      sync.RWMutex
+}
+
+func NewHub() *Hub { return &Hub{clients: map[*WSClient]struct{}{}} }
+
+func (h *Hub) Add(c *WSClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[c] = struct{}{}
+	websocketClients.Set(float64(len(h.clients)))
+}
+
+func (h *Hub) Remove(c *WSClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		c.close()
+		websocketClients.Set(float64(len(h.clients)))
+	}
+}
+
+// eventTopics derives the topic(s) an event belongs to from its payload:
+// session_* events go to "session:<id>" and the wildcard "session_events";
+// everything else that isn't a metrics tick also only reaches subscribers of
+// its specific session. "invalidate" events are internal cache-coherence
+// bookkeeping (see LocalCacheSupplier in store.go) that happens to share the
+// events stream and are never meant for clients, so they route to no topic
+// at all.
+func eventTopics(event map[string]any) []string {
+	name, _ := event["event"].(string)
+	if name == "invalidate" {
+		return nil
+	}
+	if name == "metrics" {
+		return []string{"metrics"}
+	}
+	topics := []string{"session_events"}
+	if sid, _ := event["session_id"].(string); sid != "" {
+		topics = append(topics, "session:"+sid)
+	}
+	return topics
+}
+
+// Broadcast routes v (read from the events stream by the single shared
+// consumer in main.go) to every client subscribed to one of its topics. A
+// client whose outbox is full is dropped rather than allowed to stall
+// delivery to everyone else.
+func (h *Hub) Broadcast(e StreamEntry, v map[string]any) {
+	topics := eventTopics(v)
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("hub: marshal event: %v", err)
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for c := range h.clients {
+		if !c.subscribedAny(topics) {
+			continue
+		}
+		select {
+		case c.send <- b:
+			c.setLastID(e.ID)
+		default:
+			log.Printf("hub: client outbox full, dropping connection")
+			websocketBroadcastDroppedTotal.Inc()
+			go h.Remove(c)
+		}
+	}
+}
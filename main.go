@@ -6,23 +6,41 @@
 // - GET  /api/sessions            -> list active sessions
 // - PATCH /api/sessions/:id       -> update session (status/progress)
 // - POST /api/sessions/:id/cancel -> cancel session
-// - GET  /api/metrics             -> latest metrics
+// - GET  /api/sessions/:id/events -> replay historical events for a session (?since=<id>)
+// - GET  /api/metrics             -> latest metrics (JSON)
+// - GET  /metrics                 -> Prometheus exposition
 // - GET  /healthz                 -> liveness
-// - WS   /ws                      -> subscribe to events (session_* and metrics)
+// - WS   /ws                      -> topic-filtered, resumable event stream (send {"action":"subscribe","topics":[...]}, optionally connect with ?since=<id>)
 //
 // Env vars:
 //   PORT=8080
-//   REDIS_URL=redis://localhost:6379
+//   REDIS_URL=redis://localhost:6379   // or rediss://, redis-sentinel://, redis-cluster://, memory://
 //   CORS_ORIGINS=*
+//   ENGINE=simulator   // default automation engine: simulator, chromedp, or rod
+//   CACHE_CAPACITY=1024 CACHE_TTL_SEC=30   // local session cache tuning
 //
 // Build & Run:
 //   go mod init webauto
-//   go get github.com/gofiber/fiber/v2 github.com/gofiber/websocket/v2 github.com/redis/go-redis/v9 github.com/google/uuid
+//   go get github.com/gofiber/fiber/v2 github.com/gofiber/websocket/v2 github.com/redis/go-redis/v9 github.com/google/uuid github.com/chromedp/chromedp github.com/prometheus/client_golang github.com/shirou/gopsutil/v3
 //   go run .
 //
 // Notes:
 // - This is a single-file app for clarity; you can split into packages later.
-// - Includes a background simulator that advances session progress and publishes events.
+// - Events are delivered via a Redis Stream (automation:events) rather than
+//   pub/sub, so GET /api/sessions/:id/events?since=<id> can replay anything a
+//   client missed. A single shared consumer reads the stream's live tail and
+//   fans out through the hub (see hub.go), topic-filtered and backpressured
+//   per client so one slow socket can't stall delivery to the rest; a
+//   reconnecting /ws?since=<id> client is caught up by one XRANGE call
+//   against its own topics rather than a second per-client stream reader.
+// - Session automation is pluggable (see engine.go): pick an engine per
+//   request with "engine" in the POST body, defaulting to ENGINE.
+// - The storage backend is chosen by REDIS_URL's scheme (see backend.go):
+//   standalone/sentinel/cluster Redis, or an in-process memory:// backend
+//   for local development without a Redis instance.
+// - /api/metrics' CPU/memory/goroutine/GC numbers and /metrics' counters and
+//   histograms (see metrics.go) are real probes and live instrumentation,
+//   not the ticker-driven placeholders this started as.
 
 package main
 
@@ -32,19 +50,18 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"net/url"
 	"os"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	websock "github.com/gofiber/websocket/v2"
 	"github.com/google/uuid"
-	redis "github.com/redis/go-redis/v9"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // ====== Types ======
@@ -75,6 +92,7 @@ type AutomationRequest struct {
 	TimeoutSec      int              `json:"timeout"`
 	CustomScript    *string          `json:"custom_script"`
 	Proxy           *string          `json:"proxy"`
+	Engine          string           `json:"engine"` // "simulator" (default), "chromedp", "rod"
 }
 
 type Session struct {
@@ -87,6 +105,9 @@ type Session struct {
 	MaxInteractions int              `json:"max_interactions"`
 	Headless        bool             `json:"headless"`
 	TimeoutSec      int              `json:"timeout"`
+	CustomScript    *string          `json:"custom_script,omitempty"`
+	Proxy           *string          `json:"proxy,omitempty"`
+	Engine          string           `json:"engine"`
 	Progress        int              `json:"progress"`
 	Metrics         map[string]any   `json:"metrics"`
 	Error           *string          `json:"error"`
@@ -100,137 +121,120 @@ type MetricsData struct {
 	SuccessRate      float64   `json:"success_rate"`
 	AvgResponseMs    float64   `json:"avg_response_time"`
 	TotalInteractions int      `json:"total_interactions"`
+	CacheHits        uint64    `json:"cache_hits"`
+	CacheMisses      uint64    `json:"cache_misses"`
+	Goroutines       int               `json:"goroutines"`
+	GCPauseMs        float64           `json:"gc_pause_ms"`
+	BackendHealth    map[string]string `json:"backend_health,omitempty"`
 }
 
 // ====== Redis Manager ======
+//
+// RedisManager is one shared connection, backed by whatever Backend
+// NewBackend resolved REDIS_URL's scheme to (see backend.go) — the
+// session store, the events consumer, and the metrics writer all hold the
+// same *RedisManager rather than each dialing their own client.
 
 type RedisManager struct {
-	client *redis.Client
+	backend Backend
 }
 
-func NewRedisManager(ctx context.Context, urlStr string) (*RedisManager, error) {
-	if urlStr == "" {
-		urlStr = "redis://localhost:6379"
-	}
-	u, err := url.Parse(urlStr)
-	if err != nil {
-		return nil, err
-	}
-
-	addr := u.Host
-	pass := ""
-	if u.User != nil {
-		p, _ := u.User.Password()
-		pass = p
-	}
-	opt := &redis.Options{Addr: addr, Password: pass, DB: 0}
-	client := redis.NewClient(opt)
-	if err := client.Ping(ctx).Err(); err != nil {
-		return nil, err
-	}
-	return &RedisManager{client: client}, nil
+func NewRedisManager(ctx context.Context, uri string) (*RedisManager, error) {
+	b, err := NewBackend(ctx, uri)
+	if err != nil { return nil, err }
+	return &RedisManager{backend: b}, nil
 }
 
-func (r *RedisManager) Close() error { return r.client.Close() }
-
-// Keys & channels
-const (
-	sessionsPrefix   = "automation:sessions:"
-	activeSetKey     = "automation:active_sessions"
-	metricsKey       = "automation:metrics:latest"
-	eventsChannel    = "automation:events"
-)
+func (r *RedisManager) Close() error { return r.backend.Close() }
 
-// ====== Session Store ======
+// Each passthrough below reports its own latency to
+// redisCommandDurationSeconds so /metrics reflects real backend timing
+// regardless of which Backend implementation is live.
 
-type SessionStore struct {
-	r *RedisManager
+func (r *RedisManager) Get(ctx context.Context, key string) (string, error) {
+	var v string
+	err := observeRedis("get", func() error {
+		var e error
+		v, e = r.backend.Get(ctx, key)
+		return e
+	})
+	return v, err
 }
-
-func NewSessionStore(r *RedisManager) *SessionStore { return &SessionStore{r: r} }
-
-func (s *SessionStore) Save(ctx context.Context, sess *Session) error {
-	b, _ := json.Marshal(sess)
-	// Expire one hour after timeout
-	expire := time.Duration(sess.TimeoutSec+3600) * time.Second
-	if err := s.r.client.Set(ctx, sessionsPrefix+sess.SessionID, string(b), expire).Err(); err != nil {
-		return err
-	}
-	if err := s.r.client.SAdd(ctx, activeSetKey, sess.SessionID).Err(); err != nil {
-		return err
-	}
-	return nil
+func (r *RedisManager) Set(ctx context.Context, key, value string, expire time.Duration) error {
+	return observeRedis("set", func() error { return r.backend.Set(ctx, key, value, expire) })
 }
-
-func (s *SessionStore) Get(ctx context.Context, id string) (*Session, error) {
-	res, err := s.r.client.Get(ctx, sessionsPrefix+id).Result()
-	if err != nil {
-		if errors.Is(err, redis.Nil) { return nil, fiber.ErrNotFound }
-		return nil, err
-	}
-	var sess Session
-	if err := json.Unmarshal([]byte(res), &sess); err != nil { return nil, err }
-	return &sess, nil
+func (r *RedisManager) SAdd(ctx context.Context, key, member string) error {
+	return observeRedis("sadd", func() error { return r.backend.SAdd(ctx, key, member) })
 }
-
-func (s *SessionStore) Update(ctx context.Context, id string, update func(*Session) error) (*Session, error) {
-	sess, err := s.Get(ctx, id)
-	if err != nil { return nil, err }
-	if err := update(sess); err != nil { return nil, err }
-	sess.UpdatedAt = time.Now().UTC()
-	if err := s.Save(ctx, sess); err != nil { return nil, err }
-	return sess, nil
+func (r *RedisManager) SRem(ctx context.Context, key, member string) error {
+	return observeRedis("srem", func() error { return r.backend.SRem(ctx, key, member) })
 }
-
-func (s *SessionStore) List(ctx context.Context) ([]*Session, error) {
-	ids, err := s.r.client.SMembers(ctx, activeSetKey).Result()
-	if err != nil { return nil, err }
-	out := make([]*Session, 0, len(ids))
-	for _, id := range ids {
-		if sess, err := s.Get(ctx, id); err == nil {
-			out = append(out, sess)
-		}
-	}
-	return out, nil
+func (r *RedisManager) SMembers(ctx context.Context, key string) ([]string, error) {
+	var v []string
+	err := observeRedis("smembers", func() error {
+		var e error
+		v, e = r.backend.SMembers(ctx, key)
+		return e
+	})
+	return v, err
 }
-
-func (s *SessionStore) RemoveActive(ctx context.Context, id string) error {
-	return s.r.client.SRem(ctx, activeSetKey, id).Err()
+func (r *RedisManager) SCard(ctx context.Context, key string) (int64, error) {
+	var v int64
+	err := observeRedis("scard", func() error {
+		var e error
+		v, e = r.backend.SCard(ctx, key)
+		return e
+	})
+	return v, err
 }
-
-// ====== Event Hub (WebSocket) ======
-
-type WSClient struct {
-	Conn *websock.Conn
-	Mu   sync.Mutex
+func (r *RedisManager) XAdd(ctx context.Context, stream string, maxLen int64, values map[string]any) (string, error) {
+	var v string
+	err := observeRedis("xadd", func() error {
+		var e error
+		v, e = r.backend.XAdd(ctx, stream, maxLen, values)
+		return e
+	})
+	return v, err
 }
-
-type Hub struct {
-	clients map[*WSClient]struct{}
-	mu      sync.RWMutex
+// XRead is exempt from redisCommandDurationSeconds: block means it can
+// legitimately sit for seconds waiting for new entries, which would swamp a
+// histogram meant to track actual command latency.
+func (r *RedisManager) XRead(ctx context.Context, stream, lastID string, block time.Duration, count int64) ([]StreamEntry, error) {
+	return r.backend.XRead(ctx, stream, lastID, block, count)
 }
-
-func NewHub() *Hub { return &Hub{clients: map[*WSClient]struct{}{}} }
-
-func (h *Hub) Add(c *WSClient) {
-	h.mu.Lock(); defer h.mu.Unlock()
-	h.clients[c] = struct{}{}
+func (r *RedisManager) XRange(ctx context.Context, stream, start, stop string) ([]StreamEntry, error) {
+	var v []StreamEntry
+	err := observeRedis("xrange", func() error {
+		var e error
+		v, e = r.backend.XRange(ctx, stream, start, stop)
+		return e
+	})
+	return v, err
 }
-
-func (h *Hub) Remove(c *WSClient) {
-	h.mu.Lock(); defer h.mu.Unlock()
-	delete(h.clients, c)
+func (r *RedisManager) Health(ctx context.Context) (map[string]string, error) {
+	return r.backend.Health(ctx)
 }
 
-func (h *Hub) Broadcast(v any) {
-	b, _ := json.Marshal(v)
-	h.mu.RLock(); defer h.mu.RUnlock()
-	for c := range h.clients {
-		c.Mu.Lock()
-		_ = c.Conn.WriteMessage(1, b)
-		c.Mu.Unlock()
-	}
-}
+// Keys & channels
+const (
+	sessionsPrefix  = "automation:sessions:"
+	activeSetKey    = "automation:active_sessions"
+	metricsKey      = "automation:metrics:latest"
+	eventsStream    = "automation:events"
+	eventsStreamCap = 10_000 // approx MAXLEN for XADD trimming
+)
+
+// ====== Session Store ======
+//
+// The store is a layered SessionSupplier (see store.go): a LocalCacheSupplier
+// (in-process LRU+TTL) in front of a RedisSupplier, so repeated Get calls for
+// the same session — the PATCH handler and runSession's progress loop both
+// do this on every update — don't round-trip to Redis each time.
+
+// ====== Event Hub (WebSocket) ======
+//
+// WSClient/Hub live in hub.go: topic-filtered fan-out with a buffered,
+// backpressured outbox per client (see hub.go for the subscribe protocol).
 
 // ====== Utilities ======
 
@@ -267,16 +271,24 @@ func main() {
 	if err != nil { log.Fatalf("Redis connect failed: %v", err) }
 	defer rm.Close()
 
-	store := NewSessionStore(rm)
+	redisSupplier := NewRedisSupplier(rm)
+	cache := NewLocalCacheSupplier(redisSupplier, rm, cacheCapacityFromEnv(), cacheTTLFromEnv())
+	cache.Start(ctx)
+	var store SessionSupplier = cache
 	hub := NewHub()
 	metrics := &Metrics{}
 
 	app := fiber.New()
 	app.Use(logger.New())
 	app.Use(cors.New(cors.Config{AllowOrigins: origins(), AllowHeaders: "*", AllowCredentials: true}))
+	app.Use(httpMetricsMiddleware)
 
 	app.Get("/healthz", func(c *fiber.Ctx) error { return c.SendString("ok") })
 
+	// Prometheus exposition, alongside the existing JSON snapshot at
+	// /api/metrics.
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
+
 	api := app.Group("/api")
 
 	// Create session
@@ -285,6 +297,9 @@ func main() {
 		if err := c.BodyParser(&req); err != nil { return fiber.NewError(fiber.StatusBadRequest, err.Error()) }
 		if err := validateRequest(&req); err != nil { return fiber.NewError(fiber.StatusBadRequest, err.Error()) }
 
+		engineName, engine, err := engineFor(req.Engine)
+		if err != nil { return fiber.NewError(fiber.StatusBadRequest, err.Error()) }
+
 		id := "sess_" + uuid.NewString()[:12]
 		sess := &Session{
 			SessionID:       id,
@@ -296,16 +311,19 @@ func main() {
 			MaxInteractions: req.MaxInteractions,
 			Headless:        req.Headless,
 			TimeoutSec:      req.TimeoutSec,
+			CustomScript:    req.CustomScript,
+			Proxy:           req.Proxy,
+			Engine:          engineName,
 			Progress:        0,
 			Metrics:         map[string]any{},
 		}
 		if err := store.Save(ctx, sess); err != nil { return fiber.NewError(fiber.StatusInternalServerError, err.Error()) }
+		sessionsCreatedTotal.WithLabelValues(string(sess.BehaviorPattern)).Inc()
 
 		// Publish event
-		publish(rm, map[string]any{"event": "session_created", "session_id": id})
+		publishEvent(ctx, rm, map[string]any{"event": "session_created", "session_id": id})
 
-		// kick off background simulator (replace with real automation engine)
-		go simulateSession(ctx, rm, store, hub, id)
+		go runSession(ctx, rm, store, engine, id)
 
 		return c.Status(fiber.StatusCreated).JSON(sess)
 	})
@@ -341,69 +359,119 @@ func main() {
 			return nil
 		})
 		if err != nil { return err }
-		publish(rm, map[string]any{"event": "session_updated", "session_id": id, "status": sess.Status, "progress": sess.Progress})
+		publishEvent(ctx, rm, map[string]any{"event": "session_updated", "session_id": id, "status": sess.Status, "progress": sess.Progress})
 		return c.JSON(sess)
 	})
 
 	// Cancel
 	api.Post("/sessions/:id/cancel", func(c *fiber.Ctx) error {
 		id := c.Params("id")
-		_, err := store.Update(ctx, id, func(s *Session) error {
+		sess, err := store.Update(ctx, id, func(s *Session) error {
 			s.Status = StatusCancelled
 			s.Progress = min(100, s.Progress)
 			return nil
 		})
 		if err != nil { return err }
-		publish(rm, map[string]any{"event": "session_cancelled", "session_id": id})
+		if _, engine, err := engineFor(sess.Engine); err == nil { engine.Cancel(id) }
+		publishEvent(ctx, rm, map[string]any{"event": "session_cancelled", "session_id": id})
 		return c.JSON(fiber.Map{"ok": true})
 	})
 
+	// Historical events for a session, replayed from the stream via XRANGE.
+	api.Get("/sessions/:id/events", func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		since := c.Query("since", "-")
+		entries, err := rm.XRange(ctx, eventsStream, since, "+")
+		if err != nil { return fiber.NewError(fiber.StatusInternalServerError, err.Error()) }
+
+		events := make([]fiber.Map, 0, len(entries))
+		for _, e := range entries {
+			var v map[string]any
+			if err := json.Unmarshal([]byte(e.Payload), &v); err != nil { continue }
+			if v["event"] == "invalidate" { continue }
+			if sid, _ := v["session_id"].(string); sid != id { continue }
+			events = append(events, fiber.Map{"id": e.ID, "event": v})
+		}
+		return c.JSON(events)
+	})
+
 	// Metrics
 	api.Get("/metrics", func(c *fiber.Ctx) error { return c.JSON(metrics.Get()) })
 
-	// WebSocket endpoint
+	// WebSocket endpoint. Connect, then send
+	// {"action":"subscribe","topics":["session:sess_abc","metrics","session_events"]}
+	// to start receiving live events for those topics. A reconnecting client
+	// can pick up exactly where it left off by connecting to
+	// /ws?since=<id> instead of just replaying from GET
+	// /api/sessions/:id/events itself.
+	app.Use("/ws", func(c *fiber.Ctx) error {
+		if websock.IsWebSocketUpgrade(c) { return c.Next() }
+		return fiber.ErrUpgradeRequired
+	})
 	app.Get("/ws", websock.New(func(c *websock.Conn) {
-		client := &WSClient{Conn: c}
+		client := newWSClient(c, c.Query("since", "$"))
 		hub.Add(client)
-		defer func() { hub.Remove(client); _ = c.Close() }()
-		for {
-			// Read to detect close; ignore messages
-			if _, _, err := c.ReadMessage(); err != nil { break }
-		}
+		go client.writePump()
+		defer hub.Remove(client)
+		client.readPump(ctx, rm, hub)
 	}))
 
-	// Background: subscribe Redis events and re-broadcast to WS
+	// Background: the single shared consumer for the events stream. It
+	// reads every entry once and hands it to the hub, which fans each one
+	// out only to the clients subscribed to its topic — one blocking
+	// reader regardless of how many WebSocket clients are connected.
 	go func() {
-		sub := rm.client.Subscribe(ctx, eventsChannel)
-		ch := sub.Channel()
-		for msg := range ch {
-			var v any
-			_ = json.Unmarshal([]byte(msg.Payload), &v)
-			hub.Broadcast(v)
+		lastID := "$"
+		for {
+			entries, err := rm.XRead(ctx, eventsStream, lastID, 5*time.Second, 100)
+			if err != nil {
+				log.Printf("events consumer: xread failed: %v", err)
+				time.Sleep(time.Second)
+				continue
+			}
+			for _, e := range entries {
+				lastID = e.ID
+				var v map[string]any
+				if err := json.Unmarshal([]byte(e.Payload), &v); err != nil { continue }
+				hub.Broadcast(e, v)
+			}
 		}
 	}()
 
-	// Background: metrics generator (replace with real system probes)
+	// Background: samples real CPU/mem/goroutine/GC/backend-health probes
+	// on a fixed interval (cpu.Percent needs a sampling window, so this
+	// can't run per-request).
 	go func() {
 		t := time.NewTicker(2 * time.Second)
 		defer t.Stop()
 		var tick int
 		for range t.C {
 			tick++
-			active, _ := rm.client.SCard(ctx, activeSetKey).Result()
+			active, _ := rm.SCard(ctx, activeSetKey)
+			hits, misses := cache.CacheStats()
+			sys := probeSystem(ctx)
+			health, err := rm.Health(ctx)
+			if err != nil {
+				log.Printf("metrics: backend health probe failed: %v", err)
+			}
 			md := MetricsData{
 				Timestamp:         time.Now().UTC(),
-				CPUUsage:          10 + float64((tick*7)%60),
-				MemoryUsage:       30 + float64((tick*5)%50),
+				CPUUsage:          sys.CPUPercent,
+				MemoryUsage:       sys.MemPercent,
 				ActiveSessions:    int(active),
 				SuccessRate:       0.7 + 0.3*float64((tick%10))/10.0,
 				AvgResponseMs:     120 + float64((tick*13)%200),
 				TotalInteractions: tick * 3,
+				CacheHits:         hits,
+				CacheMisses:       misses,
+				Goroutines:        sys.Goroutines,
+				GCPauseMs:         sys.PauseMs,
+				BackendHealth:     health,
 			}
 			metrics.Set(md)
 			b, _ := json.Marshal(md)
-			_ = rm.client.Set(ctx, metricsKey, b, 30*time.Second).Err()
-			publish(rm, map[string]any{"event": "metrics", "data": md})
+			_ = rm.Set(ctx, metricsKey, string(b), 30*time.Second)
+			publishEvent(ctx, rm, map[string]any{"event": "metrics", "data": md})
 		}
 	}()
 
@@ -415,9 +483,17 @@ func main() {
 
 // ====== Helpers ======
 
-func publish(rm *RedisManager, v any) {
+// publishEvent appends v to the events stream as a single "payload" field
+// (the whole event, JSON-encoded) and trims the stream to roughly
+// eventsStreamCap entries so it doesn't grow unbounded.
+func publishEvent(ctx context.Context, rm *RedisManager, v any) string {
 	b, _ := json.Marshal(v)
-	_ = rm.client.Publish(context.Background(), eventsChannel, b).Err()
+	id, err := rm.XAdd(ctx, eventsStream, eventsStreamCap, map[string]any{"payload": string(b)})
+	if err != nil {
+		log.Printf("publishEvent: xadd failed: %v", err)
+		return ""
+	}
+	return id
 }
 
 func origins() string {
@@ -427,40 +503,62 @@ func origins() string {
 
 func min(a, b int) int { if a < b { return a }; return b }
 
-// ====== Demo Session Simulator ======
+// ====== Session Runner ======
 
-func simulateSession(ctx context.Context, rm *RedisManager, store *SessionStore, hub *Hub, id string) {
-	// Start running
-	_, err := store.Update(ctx, id, func(s *Session) error {
+// runSession drives sess to completion via engine, persisting each
+// ProgressEvent it emits and streaming the corresponding session_progress
+// event. The demo simulator and the real chromedp driver both flow through
+// here unchanged.
+func runSession(ctx context.Context, rm *RedisManager, store SessionSupplier, engine AutomationEngine, id string) {
+	sess, err := store.Update(ctx, id, func(s *Session) error {
 		s.Status = StatusRunning
 		return nil
 	})
 	if err != nil { return }
-	publish(rm, map[string]any{"event": "session_started", "session_id": id})
-
-	deadline := time.Now().Add(10 * time.Second)
-	step := 0
-	for time.Now().Before(deadline) {
-		step++
-		time.Sleep(1 * time.Second)
-		progress := min(100, step*10)
-		_, err := store.Update(ctx, id, func(s *Session) error {
-			s.Progress = progress
-			// fake some metrics per session
+	publishEvent(ctx, rm, map[string]any{"event": "session_started", "session_id": id})
+	started := time.Now()
+
+	progress := make(chan ProgressEvent)
+	done := make(chan error, 1)
+	go func() { done <- engine.Run(ctx, sess, progress) }()
+
+	lastStep := started
+	for ev := range progress {
+		if ev.Err != nil { continue }
+		updated, err := store.Update(ctx, id, func(s *Session) error {
+			s.Progress = ev.Progress
 			if s.Metrics == nil { s.Metrics = map[string]any{} }
-			s.Metrics["last_step_ms"] = 800 + step*25
+			for k, v := range ev.Metrics { s.Metrics[k] = v }
 			return nil
 		})
 		if err != nil { break }
-		publish(rm, map[string]any{"event": "session_progress", "session_id": id, "progress": progress})
+		now := time.Now()
+		sessionProgressStepSeconds.Observe(now.Sub(lastStep).Seconds())
+		lastStep = now
+		publishEvent(ctx, rm, map[string]any{"event": "session_progress", "session_id": id, "progress": updated.Progress})
+	}
+
+	runErr := <-done
+
+	finalStatus := StatusCompleted
+	var errMsg *string
+	switch {
+	case errors.Is(runErr, context.Canceled):
+		finalStatus = StatusCancelled
+	case runErr != nil:
+		finalStatus = StatusFailed
+		msg := runErr.Error()
+		errMsg = &msg
 	}
 
-	// Finish
 	_, _ = store.Update(ctx, id, func(s *Session) error {
-		s.Status = StatusCompleted
-		s.Progress = 100
+		s.Status = finalStatus
+		if finalStatus == StatusCompleted { s.Progress = 100 }
+		s.Error = errMsg
 		return nil
 	})
 	_ = store.RemoveActive(ctx, id)
-	publish(rm, map[string]any{"event": "session_completed", "session_id": id})
+	sessionsCompletedTotal.WithLabelValues(string(finalStatus)).Inc()
+	sessionDurationSeconds.Observe(time.Since(started).Seconds())
+	publishEvent(ctx, rm, map[string]any{"event": "session_completed", "session_id": id, "status": finalStatus})
 }
@@ -0,0 +1,289 @@
+// store.go
+// A layered session store: LocalCacheSupplier (in-process LRU+TTL) in front
+// of RedisSupplier (the source of truth). This is the supplier pattern used
+// throughout large Go/Redis codebases — both suppliers satisfy the same
+// SessionSupplier interface, so callers (main.go, runSession) never know
+// which tier answered a given call.
+//
+// Get hits the local cache first and only falls back to Redis on a miss.
+// Save/Update write through Redis and then invalidate the local entry on
+// every replica by publishing an "invalidate" event on the events stream,
+// which each node's LocalCacheSupplier subscribes to independently.
+
+package main
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SessionSupplier is the storage surface both tiers implement.
+type SessionSupplier interface {
+	Save(ctx context.Context, sess *Session) error
+	Get(ctx context.Context, id string) (*Session, error)
+	Update(ctx context.Context, id string, update func(*Session) error) (*Session, error)
+	List(ctx context.Context) ([]*Session, error)
+	RemoveActive(ctx context.Context, id string) error
+}
+
+// ====== Redis-backed supplier (source of truth) ======
+
+type RedisSupplier struct {
+	r *RedisManager
+}
+
+func NewRedisSupplier(r *RedisManager) *RedisSupplier { return &RedisSupplier{r: r} }
+
+func (s *RedisSupplier) Save(ctx context.Context, sess *Session) error {
+	b, _ := json.Marshal(sess)
+	// Expire one hour after timeout
+	expire := time.Duration(sess.TimeoutSec+3600) * time.Second
+	if err := s.r.Set(ctx, sessionsPrefix+sess.SessionID, string(b), expire); err != nil {
+		return err
+	}
+	if err := s.r.SAdd(ctx, activeSetKey, sess.SessionID); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *RedisSupplier) Get(ctx context.Context, id string) (*Session, error) {
+	res, err := s.r.Get(ctx, sessionsPrefix+id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) { return nil, fiber.ErrNotFound }
+		return nil, err
+	}
+	var sess Session
+	if err := json.Unmarshal([]byte(res), &sess); err != nil { return nil, err }
+	return &sess, nil
+}
+
+func (s *RedisSupplier) Update(ctx context.Context, id string, update func(*Session) error) (*Session, error) {
+	sess, err := s.Get(ctx, id)
+	if err != nil { return nil, err }
+	if err := update(sess); err != nil { return nil, err }
+	sess.UpdatedAt = time.Now().UTC()
+	if err := s.Save(ctx, sess); err != nil { return nil, err }
+	return sess, nil
+}
+
+func (s *RedisSupplier) List(ctx context.Context) ([]*Session, error) {
+	ids, err := s.r.SMembers(ctx, activeSetKey)
+	if err != nil { return nil, err }
+	out := make([]*Session, 0, len(ids))
+	for _, id := range ids {
+		if sess, err := s.Get(ctx, id); err == nil {
+			out = append(out, sess)
+		}
+	}
+	return out, nil
+}
+
+func (s *RedisSupplier) RemoveActive(ctx context.Context, id string) error {
+	return s.r.SRem(ctx, activeSetKey, id)
+}
+
+// ====== Local cache supplier (LRU + TTL in front of Redis) ======
+
+const (
+	defaultCacheCapacity = 1024
+	defaultCacheTTL      = 30 * time.Second
+)
+
+func cacheCapacityFromEnv() int {
+	if v := os.Getenv("CACHE_CAPACITY"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 { return n }
+	}
+	return defaultCacheCapacity
+}
+
+func cacheTTLFromEnv() time.Duration {
+	if v := os.Getenv("CACHE_TTL_SEC"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 { return time.Duration(n) * time.Second }
+	}
+	return defaultCacheTTL
+}
+
+type cacheEntry struct {
+	id        string
+	sess      *Session
+	expiresAt time.Time
+	elem      *list.Element
+}
+
+// LocalCacheSupplier sits in front of a RedisSupplier (or any SessionSupplier)
+// with an in-process LRU cache of *Session, invalidated across every replica
+// via the events stream rather than a fixed TTL alone.
+type LocalCacheSupplier struct {
+	next     SessionSupplier
+	rm       *RedisManager
+	capacity int
+	ttl      time.Duration
+
+	mu    sync.Mutex
+	cache map[string]*cacheEntry
+	order *list.List // front = most recently used
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func NewLocalCacheSupplier(next SessionSupplier, rm *RedisManager, capacity int, ttl time.Duration) *LocalCacheSupplier {
+	return &LocalCacheSupplier{
+		next:     next,
+		rm:       rm,
+		capacity: capacity,
+		ttl:      ttl,
+		cache:    map[string]*cacheEntry{},
+		order:    list.New(),
+	}
+}
+
+// Start spawns the invalidation listener: a keywatcher-style consumer,
+// independent of the hub's, that evicts local entries whenever any replica
+// (including this one) publishes an "invalidate" event for a session.
+func (c *LocalCacheSupplier) Start(ctx context.Context) {
+	go func() {
+		lastID := "$"
+		for {
+			entries, err := c.rm.XRead(ctx, eventsStream, lastID, 5*time.Second, 100)
+			if err != nil {
+				log.Printf("cache invalidation listener: xread failed: %v", err)
+				time.Sleep(time.Second)
+				continue
+			}
+			for _, e := range entries {
+				lastID = e.ID
+				var v map[string]any
+				if err := json.Unmarshal([]byte(e.Payload), &v); err != nil { continue }
+				if v["event"] != "invalidate" { continue }
+				if sid, _ := v["session_id"].(string); sid != "" {
+					c.evict(sid)
+				}
+			}
+		}
+	}()
+}
+
+func (c *LocalCacheSupplier) evict(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.cache[id]; ok {
+		c.order.Remove(e.elem)
+		delete(c.cache, id)
+	}
+}
+
+// cloneSession deep-copies sess via a JSON round-trip so the cache and its
+// callers never share a live *Session (and its Metrics map) across
+// goroutines — runSession's progress loop and an HTTP handler for the same
+// session id are a completely normal case of two callers racing on
+// "the same" session.
+func cloneSession(sess *Session) *Session {
+	b, err := json.Marshal(sess)
+	if err != nil {
+		log.Printf("local cache: clone session: marshal: %v", err)
+		return sess
+	}
+	var out Session
+	if err := json.Unmarshal(b, &out); err != nil {
+		log.Printf("local cache: clone session: unmarshal: %v", err)
+		return sess
+	}
+	return &out
+}
+
+func (c *LocalCacheSupplier) lookup(id string) (*Session, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.cache[id]
+	if !ok { return nil, false }
+	if time.Now().After(e.expiresAt) {
+		c.order.Remove(e.elem)
+		delete(c.cache, id)
+		return nil, false
+	}
+	c.order.MoveToFront(e.elem)
+	return cloneSession(e.sess), true
+}
+
+func (c *LocalCacheSupplier) store(sess *Session) {
+	sess = cloneSession(sess)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.cache[sess.SessionID]; ok {
+		e.sess = sess
+		e.expiresAt = time.Now().Add(c.ttl)
+		c.order.MoveToFront(e.elem)
+		return
+	}
+	elem := c.order.PushFront(sess.SessionID)
+	c.cache[sess.SessionID] = &cacheEntry{id: sess.SessionID, sess: sess, expiresAt: time.Now().Add(c.ttl), elem: elem}
+	for c.order.Len() > c.capacity {
+		back := c.order.Back()
+		if back == nil { break }
+		c.order.Remove(back)
+		delete(c.cache, back.Value.(string))
+	}
+}
+
+// invalidate evicts locally and publishes so every other replica evicts too.
+func (c *LocalCacheSupplier) invalidate(ctx context.Context, id string) {
+	c.evict(id)
+	publishEvent(ctx, c.rm, map[string]any{"event": "invalidate", "session_id": id})
+}
+
+func (c *LocalCacheSupplier) Get(ctx context.Context, id string) (*Session, error) {
+	if sess, ok := c.lookup(id); ok {
+		c.hits.Add(1)
+		return sess, nil
+	}
+	c.misses.Add(1)
+	sess, err := c.next.Get(ctx, id)
+	if err != nil { return nil, err }
+	c.store(sess)
+	return sess, nil
+}
+
+func (c *LocalCacheSupplier) Save(ctx context.Context, sess *Session) error {
+	if err := c.next.Save(ctx, sess); err != nil { return err }
+	c.invalidate(ctx, sess.SessionID)
+	return nil
+}
+
+func (c *LocalCacheSupplier) Update(ctx context.Context, id string, update func(*Session) error) (*Session, error) {
+	sess, err := c.Get(ctx, id)
+	if err != nil { return nil, err }
+	if err := update(sess); err != nil { return nil, err }
+	sess.UpdatedAt = time.Now().UTC()
+	if err := c.Save(ctx, sess); err != nil { return nil, err }
+	return sess, nil
+}
+
+func (c *LocalCacheSupplier) List(ctx context.Context) ([]*Session, error) {
+	// Active-session listing always goes straight to Redis: the set of active
+	// IDs changes too often for the local cache to usefully short-circuit it,
+	// and per-id results still benefit from Get's cache on the next call.
+	return c.next.List(ctx)
+}
+
+func (c *LocalCacheSupplier) RemoveActive(ctx context.Context, id string) error {
+	if err := c.next.RemoveActive(ctx, id); err != nil { return err }
+	c.invalidate(ctx, id)
+	return nil
+}
+
+// CacheStats reports cumulative hit/miss counts for /api/metrics.
+func (c *LocalCacheSupplier) CacheStats() (hits, misses uint64) {
+	return c.hits.Load(), c.misses.Load()
+}
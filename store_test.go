@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func newTestRedisManager(t *testing.T) *RedisManager {
+	t.Helper()
+	rm, err := NewRedisManager(context.Background(), "memory://")
+	if err != nil {
+		t.Fatalf("NewRedisManager(memory://): %v", err)
+	}
+	return rm
+}
+
+func TestLocalCacheSupplierGetFallsBackOnMiss(t *testing.T) {
+	ctx := context.Background()
+	rm := newTestRedisManager(t)
+	redisSupplier := NewRedisSupplier(rm)
+	cache := NewLocalCacheSupplier(redisSupplier, rm, defaultCacheCapacity, defaultCacheTTL)
+
+	sess := &Session{SessionID: "sess_1", Status: StatusPending, TimeoutSec: 60}
+	if err := redisSupplier.Save(ctx, sess); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	if _, hits := cache.CacheStats(); hits != 0 {
+		t.Fatalf("hits before any Get = %d, want 0", hits)
+	}
+	if _, err := cache.Get(ctx, "sess_1"); err != nil {
+		t.Fatalf("Get (miss, populates cache): %v", err)
+	}
+	if _, err := cache.Get(ctx, "sess_1"); err != nil {
+		t.Fatalf("Get (hit): %v", err)
+	}
+	hits, misses := cache.CacheStats()
+	if hits != 1 || misses != 1 {
+		t.Fatalf("CacheStats = hits=%d misses=%d, want hits=1 misses=1", hits, misses)
+	}
+}
+
+func TestLocalCacheSupplierSaveEvictsRatherThanPopulates(t *testing.T) {
+	ctx := context.Background()
+	rm := newTestRedisManager(t)
+	redisSupplier := NewRedisSupplier(rm)
+	cache := NewLocalCacheSupplier(redisSupplier, rm, defaultCacheCapacity, defaultCacheTTL)
+
+	if _, err := cache.Get(ctx, "sess_1"); err == nil {
+		t.Fatal("Get before Save = nil error, want ErrNotFound/fiber.ErrNotFound")
+	}
+
+	sess := &Session{SessionID: "sess_1", Status: StatusPending, TimeoutSec: 60}
+	if err := cache.Save(ctx, sess); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// Save writes through and invalidates rather than populating the local
+	// cache, so the entry is only cached lazily on the next Get.
+	if _, ok := cache.lookup("sess_1"); ok {
+		t.Fatal("lookup right after Save = hit, want miss (Save invalidates, it doesn't populate)")
+	}
+	if _, err := cache.Get(ctx, "sess_1"); err != nil {
+		t.Fatalf("Get after Save: %v", err)
+	}
+	if _, ok := cache.lookup("sess_1"); !ok {
+		t.Fatal("lookup after Get = miss, want the entry Get just populated")
+	}
+}
+
+// TestInvalidateEventsAreNotClientFacing guards the store/hub contract:
+// LocalCacheSupplier.invalidate shares automation:events with real session
+// events, so eventTopics (hub.go) must keep routing "invalidate" payloads to
+// no topic at all rather than fanning them out to subscribed WS clients.
+func TestInvalidateEventsAreNotClientFacing(t *testing.T) {
+	topics := eventTopics(map[string]any{"event": "invalidate", "session_id": "sess_1"})
+	if len(topics) != 0 {
+		t.Fatalf("eventTopics(invalidate) = %v, want no topics", topics)
+	}
+}
+
+// TestLocalCacheSupplierGetReturnsIndependentSessions guards against
+// handing out the live cached *Session: runSession's progress loop and an
+// HTTP handler for the same session id race on "the same" session under
+// normal operation, so two Get calls must never return pointers (or a
+// Metrics map) that a mutation on one can be observed through the other.
+func TestLocalCacheSupplierGetReturnsIndependentSessions(t *testing.T) {
+	ctx := context.Background()
+	rm := newTestRedisManager(t)
+	redisSupplier := NewRedisSupplier(rm)
+	cache := NewLocalCacheSupplier(redisSupplier, rm, defaultCacheCapacity, defaultCacheTTL)
+
+	sess := &Session{SessionID: "sess_1", Status: StatusPending, TimeoutSec: 60, Metrics: map[string]any{}}
+	if err := redisSupplier.Save(ctx, sess); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	a, err := cache.Get(ctx, "sess_1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	b, err := cache.Get(ctx, "sess_1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if a == b {
+		t.Fatal("two Get calls returned the identical *Session pointer, want independent copies")
+	}
+
+	a.Progress = 50
+	a.Metrics["k"] = "v"
+	if b.Progress == 50 {
+		t.Fatal("mutating one Get result's Progress changed another's")
+	}
+	if _, ok := b.Metrics["k"]; ok {
+		t.Fatal("mutating one Get result's Metrics changed another's")
+	}
+}
+
+// TestLocalCacheSupplierConcurrentGetUpdateIsRaceFree exercises the exact
+// pattern that used to trip `go test -race` (and panic with "concurrent map
+// writes" outside the race build): one goroutine repeatedly Update-ing a
+// session's Metrics map while another concurrently Gets it.
+func TestLocalCacheSupplierConcurrentGetUpdateIsRaceFree(t *testing.T) {
+	ctx := context.Background()
+	rm := newTestRedisManager(t)
+	redisSupplier := NewRedisSupplier(rm)
+	cache := NewLocalCacheSupplier(redisSupplier, rm, defaultCacheCapacity, defaultCacheTTL)
+
+	sess := &Session{SessionID: "sess_1", Status: StatusPending, TimeoutSec: 60, Metrics: map[string]any{}}
+	if err := redisSupplier.Save(ctx, sess); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			_, _ = cache.Update(ctx, "sess_1", func(s *Session) error {
+				s.Progress = i
+				s.Metrics["tick"] = i
+				return nil
+			})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if _, err := cache.Get(ctx, "sess_1"); err != nil {
+				t.Errorf("Get: %v", err)
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestPublishEventRoundTripsThroughMemoryBackend(t *testing.T) {
+	ctx := context.Background()
+	rm := newTestRedisManager(t)
+
+	id := publishEvent(ctx, rm, map[string]any{"event": "session_created", "session_id": "sess_1"})
+	if id == "" {
+		t.Fatal("publishEvent returned an empty ID")
+	}
+
+	entries, err := rm.XRange(ctx, eventsStream, "-", "+")
+	if err != nil {
+		t.Fatalf("XRange: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != id {
+		t.Fatalf("XRange after publishEvent = %v, want one entry with ID %q", entries, id)
+	}
+}